@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+// fieldValue resolves path (a full RFC 9535 JSONPath: dotted names,
+// wildcards, slices, unions, filters) against a JSON-ish Node and
+// returns its first match as a Node, or UNDEFINED_RESULT if the path
+// selects nothing. It goes through CompileJSONPath's cache, so each
+// distinct path is parsed once, and the window aggregation functions
+// below get the full selector grammar, not just dotted names.
+func fieldValue(n Node, path string) Node {
+	p, _ := CompileJSONPath(path)
+	return p.eval1(n)
+}
+
+// aggFunc is implemented by the built-in window aggregations. Each
+// receives the raw events buffered for a closed pane and the field's
+// source path, and returns the folded Node.
+type aggFunc func(events []Node, path string) Node
+
+var aggFuncs = map[string]aggFunc{
+	"sum":   aggSum,
+	"avg":   aggAvg,
+	"count": aggCount,
+	"min":   aggMinMax(false),
+	"max":   aggMinMax(true),
+	"first": aggFirst,
+	"last":  aggLast,
+}
+
+// evalAggField evaluates one FieldExpr over a window's buffered events,
+// returning the name to publish it under (its alias, or the called
+// function's name) and the folded Node. Non-aggregate fields (a bare
+// path or literal) are evaluated against the last event in the pane.
+func evalAggField(f *FieldExpr, events []Node) (string, Node) {
+	name := f.alias
+	switch exp := f.exp.(type) {
+	case *CallExpr:
+		if name == "" {
+			name = exp.FuncName()
+		}
+		fn, ok := aggFuncs[exp.FuncName()]
+		if !ok {
+			return name, UNDEFINED_RESULT
+		}
+		path := ""
+		if args := exp.Args(); len(args) > 0 {
+			if p, ok := args[0].(*JSONPathExpr); ok {
+				path = p.val
+			}
+		}
+		return name, fn(events, path)
+	case *JSONPathExpr:
+		if name == "" {
+			name = exp.val
+		}
+		if len(events) == 0 {
+			return name, UNDEFINED_RESULT
+		}
+		return name, exp.eval1(events[len(events)-1])
+	case Node:
+		return name, exp
+	default:
+		return name, UNDEFINED_RESULT
+	}
+}
+
+func aggNumbers(events []Node, path string) []float64 {
+	out := make([]float64, 0, len(events))
+	for _, ev := range events {
+		v := fieldValue(ev, path)
+		if f, ok := v.To(Float).(FloatNode); ok {
+			out = append(out, float64(f))
+		}
+	}
+	return out
+}
+
+func aggSum(events []Node, path string) Node {
+	var sum float64
+	for _, v := range aggNumbers(events, path) {
+		sum += v
+	}
+	return FloatNode(sum)
+}
+
+func aggAvg(events []Node, path string) Node {
+	vals := aggNumbers(events, path)
+	if len(vals) == 0 {
+		return UNDEFINED_RESULT
+	}
+	var sum float64
+	for _, v := range vals {
+		sum += v
+	}
+	return FloatNode(sum / float64(len(vals)))
+}
+
+func aggCount(events []Node, _ string) Node {
+	return IntNode(len(events))
+}
+
+func aggMinMax(max bool) aggFunc {
+	return func(events []Node, path string) Node {
+		vals := aggNumbers(events, path)
+		if len(vals) == 0 {
+			return UNDEFINED_RESULT
+		}
+		best := vals[0]
+		for _, v := range vals[1:] {
+			if (max && v > best) || (!max && v < best) {
+				best = v
+			}
+		}
+		return FloatNode(best)
+	}
+}
+
+func aggFirst(events []Node, path string) Node {
+	if len(events) == 0 {
+		return UNDEFINED_RESULT
+	}
+	return fieldValue(events[0], path)
+}
+
+func aggLast(events []Node, path string) Node {
+	if len(events) == 0 {
+		return UNDEFINED_RESULT
+	}
+	return fieldValue(events[len(events)-1], path)
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import (
+	"math/big"
+	"regexp"
+	"strconv"
+)
+
+// DecimalNode holds an exact rational number, so monetary and IoT
+// sensor values don't silently lose precision the way they do crossing
+// through FloatNode's float64. It is produced by NewNode for inputs
+// that would otherwise lose precision (json.Number, *big.Int, *big.Rat,
+// or a numeric string that overflows int64/isn't exact as a float64),
+// and by decimal-promoted BinaryExpr arithmetic.
+type DecimalNode struct {
+	rat *big.Rat
+}
+
+// NewDecimalNode wraps an existing big.Rat as a DecimalNode.
+func NewDecimalNode(r *big.Rat) DecimalNode { return DecimalNode{rat: r} }
+
+func (d DecimalNode) Type() Type         { return Decimal }
+func (d DecimalNode) Value() interface{} { return d.rat }
+func (d DecimalNode) String() string     { return decimalString(d.rat) }
+func (DecimalNode) expr()                {}
+
+func (d DecimalNode) To(typ Type) Node {
+	switch typ {
+	case Decimal:
+		return d
+	case Float:
+		f, _ := d.rat.Float64()
+		return FloatNode(f)
+	case Int:
+		q := new(big.Int).Quo(d.rat.Num(), d.rat.Denom())
+		if !q.IsInt64() {
+			return UNDEFINED_RESULT
+		}
+		return IntNode(q.Int64())
+	case Number:
+		if d.rat.IsInt() {
+			return d.To(Int)
+		}
+		return d
+	case String:
+		return StringNode(decimalString(d.rat))
+	}
+	return UNDEFINED_RESULT
+}
+
+// decimalString renders r as a plain decimal, never using exponent
+// notation: an integer prints bare, a fraction prints rounded to 34
+// digits after the point and then trims trailing zeros.
+func decimalString(r *big.Rat) string {
+	if r == nil {
+		return "0"
+	}
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := r.FloatString(34)
+	i := len(s)
+	for i > 0 && s[i-1] == '0' {
+		i--
+	}
+	if i > 0 && s[i-1] == '.' {
+		i--
+	}
+	return s[:i]
+}
+
+var numericStringPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// decimalFromString promotes s to a DecimalNode if it is a bare numeral
+// that would lose precision as both int64 and float64; it returns
+// (_, false) for anything that round-trips cleanly through one of
+// those, leaving the caller to keep its existing StringNode/IntNode/
+// FloatNode behavior.
+func decimalFromString(s string) (DecimalNode, bool) {
+	if !numericStringPattern.MatchString(s) {
+		return DecimalNode{}, false
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return DecimalNode{}, false
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return DecimalNode{}, false
+	}
+	if _, exact := r.Float64(); exact {
+		return DecimalNode{}, false
+	}
+	return DecimalNode{rat: r}, true
+}
+
+// decimalFromNumber parses a json.Number (or any plain numeral string)
+// into the narrowest exact Node: IntNode when it fits int64, otherwise
+// FloatNode when float64 represents it exactly, otherwise DecimalNode.
+func decimalFromNumber(s string) Node {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return IntNode(i)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return UNDEFINED_RESULT
+	}
+	if f, exact := r.Float64(); exact {
+		return FloatNode(f)
+	}
+	return DecimalNode{rat: r}
+}
+
+// nodeFromBigInt narrows i to an IntNode when it fits int64, otherwise
+// preserves it exactly as a DecimalNode.
+func nodeFromBigInt(i *big.Int) Node {
+	if i.IsInt64() {
+		return IntNode(i.Int64())
+	}
+	return DecimalNode{rat: new(big.Rat).SetInt(i)}
+}
+
+// nodeFromBigRat narrows r to the tightest exact Node: IntNode when r is
+// a whole number that fits int64, FloatNode when float64 represents it
+// exactly, otherwise DecimalNode.
+func nodeFromBigRat(r *big.Rat) Node {
+	if r.IsInt() && r.Num().IsInt64() {
+		return IntNode(r.Num().Int64())
+	}
+	if f, exact := r.Float64(); exact {
+		return FloatNode(f)
+	}
+	return DecimalNode{rat: r}
+}
+
+// evalDecimalArith performs +, -, *, / on lhs/rhs via exact big.Rat
+// arithmetic. It backs evalArith whenever either operand is a
+// DecimalNode, so a Decimal operand never gets downgraded to float64
+// mid-expression.
+func evalDecimalArith(op int, lhs, rhs Node) Node {
+	l, ok := lhs.To(Decimal).(DecimalNode)
+	if !ok {
+		return UNDEFINED_RESULT
+	}
+	r, ok := rhs.To(Decimal).(DecimalNode)
+	if !ok {
+		return UNDEFINED_RESULT
+	}
+	result := new(big.Rat)
+	switch op {
+	case OpAdd:
+		result.Add(l.rat, r.rat)
+	case OpSub:
+		result.Sub(l.rat, r.rat)
+	case OpMul:
+		result.Mul(l.rat, r.rat)
+	case OpDiv:
+		if r.rat.Sign() == 0 {
+			return UNDEFINED_RESULT
+		}
+		result.Quo(l.rat, r.rat)
+	default:
+		return UNDEFINED_RESULT
+	}
+	return NewDecimalNode(result)
+}
+
+// evalDecimalCompare orders lhs/rhs by exact big.Rat comparison, so
+// ordering a Decimal against another numeric operand doesn't round
+// through float64 first.
+func evalDecimalCompare(op int, lhs, rhs Node) Node {
+	l, ok := lhs.To(Decimal).(DecimalNode)
+	if !ok {
+		return UNDEFINED_RESULT
+	}
+	r, ok := rhs.To(Decimal).(DecimalNode)
+	if !ok {
+		return UNDEFINED_RESULT
+	}
+	c := l.rat.Cmp(r.rat)
+	switch op {
+	case OpLt:
+		return BoolNode(c < 0)
+	case OpLe:
+		return BoolNode(c <= 0)
+	case OpGt:
+		return BoolNode(c > 0)
+	case OpGe:
+		return BoolNode(c >= 0)
+	}
+	return UNDEFINED_RESULT
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestNewNodePromotesOverflowingNumerals(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      interface{}
+		wantTyp Type
+		wantStr string
+	}{
+		{
+			name:    "non-numeric string stays a string",
+			in:      "hello",
+			wantTyp: String,
+			wantStr: "hello",
+		},
+		{
+			name:    "numeral that fits int64 stays a string, not promoted",
+			in:      "12345",
+			wantTyp: String,
+			wantStr: "12345",
+		},
+		{
+			name:    "numeral overflowing int64 promotes to Decimal",
+			in:      "123456789012345678901234567890",
+			wantTyp: Decimal,
+			wantStr: "123456789012345678901234567890",
+		},
+		{
+			name:    "json.Number overflowing int64 promotes to Decimal",
+			in:      json.Number("100000000000000000000.5"),
+			wantTyp: Decimal,
+			wantStr: "100000000000000000000.5",
+		},
+		{
+			name:    "big.Int fitting int64 narrows to Int",
+			in:      big.NewInt(42),
+			wantTyp: Int,
+			wantStr: "42",
+		},
+		{
+			name:    "big.Int overflowing int64 stays Decimal",
+			in:      new(big.Int).Lsh(big.NewInt(1), 100),
+			wantTyp: Decimal,
+			wantStr: new(big.Int).Lsh(big.NewInt(1), 100).String(),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := NewNode(tc.in)
+			if n.Type() != tc.wantTyp {
+				t.Errorf("Type() = %v, want %v", n.Type(), tc.wantTyp)
+			}
+			if n.String() != tc.wantStr {
+				t.Errorf("String() = %q, want %q", n.String(), tc.wantStr)
+			}
+		})
+	}
+}
+
+func TestDecimalArithmeticPromotion(t *testing.T) {
+	// A Decimal operand must promote the whole BinaryExpr to exact
+	// big.Rat arithmetic rather than rounding through float64, which is
+	// exactly the precision sums of many small floats lose.
+	big1, ok := decimalFromString("100000000000000000.1")
+	if !ok {
+		t.Fatal("decimalFromString did not promote a string that overflows int64")
+	}
+	result := evalArith(OpAdd, big1, IntNode(1))
+	dn, ok := result.(DecimalNode)
+	if !ok {
+		t.Fatalf("evalArith() = %T, want DecimalNode", result)
+	}
+	want := new(big.Rat).SetInt64(1)
+	want.Add(want, big1.rat)
+	if dn.rat.Cmp(want) != 0 {
+		t.Errorf("evalArith() = %s, want %s", dn.String(), decimalString(want))
+	}
+}
+
+func TestDecimalEqualityIsExact(t *testing.T) {
+	a, ok := decimalFromString("100000000000000000.1")
+	if !ok {
+		t.Fatal("decimalFromString did not promote")
+	}
+	b, ok := decimalFromString("100000000000000000.2")
+	if !ok {
+		t.Fatal("decimalFromString did not promote")
+	}
+	if nodesEqual(a, b) {
+		t.Error("nodesEqual(100000000000000000.1, 100000000000000000.2) = true, want false")
+	}
+	if !nodesEqual(a, a) {
+		t.Error("nodesEqual(a, a) = false, want true")
+	}
+}
+
+func TestDecimalNodeToIntOverflow(t *testing.T) {
+	huge := NewDecimalNode(new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 100)))
+	if got := huge.To(Int); got != UNDEFINED_RESULT {
+		t.Errorf("To(Int) on an int64-overflowing Decimal = %v, want UNDEFINED_RESULT", got)
+	}
+}
+
+func TestDecimalStringNoExponentNotation(t *testing.T) {
+	r, ok := new(big.Rat).SetString("0.1")
+	if !ok {
+		t.Fatal("SetString failed")
+	}
+	got := decimalString(r)
+	if got != "0.1" {
+		t.Errorf("decimalString(0.1) = %q, want %q", got, "0.1")
+	}
+}
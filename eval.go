@@ -0,0 +1,303 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import "strings"
+
+// Env carries the values an expression tree resolves free references
+// against: `@` (the node currently under consideration, e.g. one array
+// element inside a JSONPath filter) and `$` (the document root).
+type Env struct {
+	Current Node
+	Root    Node
+}
+
+// Builtins are the functions a CallExpr may invoke from within a filter
+// or switch expression. They are pure: same args, same result, no
+// side effects, which is also what makes them safe for the optimizer's
+// constant folding to call at compile time.
+var Builtins = map[string]func(args []Node) Node{
+	"len":       builtinLen,
+	"upper":     builtinUpper,
+	"lower":     builtinLower,
+	"substring": builtinSubstring,
+}
+
+func builtinLen(args []Node) Node {
+	if len(args) != 1 {
+		return UNDEFINED_RESULT
+	}
+	switch v := args[0].(type) {
+	case StringNode:
+		return IntNode(len(string(v)))
+	case ArrayNode:
+		return IntNode(len(v.Value().([]interface{})))
+	default:
+		return UNDEFINED_RESULT
+	}
+}
+
+func builtinUpper(args []Node) Node {
+	if len(args) != 1 {
+		return UNDEFINED_RESULT
+	}
+	s, ok := args[0].To(String).(StringNode)
+	if !ok {
+		return UNDEFINED_RESULT
+	}
+	return StringNode(strings.ToUpper(string(s)))
+}
+
+func builtinLower(args []Node) Node {
+	if len(args) != 1 {
+		return UNDEFINED_RESULT
+	}
+	s, ok := args[0].To(String).(StringNode)
+	if !ok {
+		return UNDEFINED_RESULT
+	}
+	return StringNode(strings.ToLower(string(s)))
+}
+
+func builtinSubstring(args []Node) Node {
+	if len(args) < 2 {
+		return UNDEFINED_RESULT
+	}
+	s, ok := args[0].To(String).(StringNode)
+	if !ok {
+		return UNDEFINED_RESULT
+	}
+	start, ok := args[1].To(Int).(IntNode)
+	if !ok || int(start) < 0 || int(start) > len(s) {
+		return UNDEFINED_RESULT
+	}
+	end := len(s)
+	if len(args) >= 3 {
+		e, ok := args[2].To(Int).(IntNode)
+		if !ok || int(e) < int(start) || int(e) > len(s) {
+			return UNDEFINED_RESULT
+		}
+		end = int(e)
+	}
+	return StringNode(string(s)[start:end])
+}
+
+// EvalExpr evaluates an expression tree against env, resolving
+// JSONPathExpr leaves against env.Current ("@...") or env.Root
+// ("$..."), and invoking Builtins for CallExpr nodes.
+func EvalExpr(e Expr, env *Env) Node {
+	switch v := e.(type) {
+	case nil:
+		return UNDEFINED_RESULT
+	case Node:
+		return v
+	case *JSONPathExpr:
+		return evalJSONPathRef(v, env)
+	case *BinaryExpr:
+		return evalBinary(v, env)
+	case *CallExpr:
+		return evalCall(v, env)
+	default:
+		return UNDEFINED_RESULT
+	}
+}
+
+func evalJSONPathRef(p *JSONPathExpr, env *Env) Node {
+	switch {
+	case strings.HasPrefix(p.val, "@"):
+		if env == nil || env.Current == nil {
+			return UNDEFINED_RESULT
+		}
+		return p.eval1(env.Current)
+	case strings.HasPrefix(p.val, "$"):
+		if env == nil || env.Root == nil {
+			return UNDEFINED_RESULT
+		}
+		return p.eval1(env.Root)
+	default:
+		if env == nil || env.Current == nil {
+			return UNDEFINED_RESULT
+		}
+		return p.eval1(env.Current)
+	}
+}
+
+func evalCall(c *CallExpr, env *Env) Node {
+	fn, ok := Builtins[c.FuncName()]
+	if !ok {
+		return UNDEFINED_RESULT
+	}
+	args := make([]Node, 0, len(c.Args()))
+	for _, a := range c.Args() {
+		args = append(args, EvalExpr(a, env))
+	}
+	return fn(args)
+}
+
+func evalBinary(b *BinaryExpr, env *Env) Node {
+	if b.Op == OpNot {
+		v := EvalExpr(b.LHS, env)
+		bn, ok := v.To(Bool).(BoolNode)
+		if !ok {
+			return UNDEFINED_RESULT
+		}
+		return !bn
+	}
+
+	lhs := EvalExpr(b.LHS, env)
+	if b.Op == OpAnd || b.Op == OpOr {
+		lb, ok := lhs.To(Bool).(BoolNode)
+		if !ok {
+			return UNDEFINED_RESULT
+		}
+		if b.Op == OpAnd && !bool(lb) {
+			return BoolNode(false)
+		}
+		if b.Op == OpOr && bool(lb) {
+			return BoolNode(true)
+		}
+		rhs := EvalExpr(b.RHS, env)
+		rb, ok := rhs.To(Bool).(BoolNode)
+		if !ok {
+			return UNDEFINED_RESULT
+		}
+		return rb
+	}
+
+	rhs := EvalExpr(b.RHS, env)
+	switch b.Op {
+	case OpEq:
+		return BoolNode(nodesEqual(lhs, rhs))
+	case OpNe:
+		return BoolNode(!nodesEqual(lhs, rhs))
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod:
+		return evalArith(b.Op, lhs, rhs)
+	case OpLt, OpLe, OpGt, OpGe:
+		return evalCompare(b.Op, lhs, rhs)
+	default:
+		return UNDEFINED_RESULT
+	}
+}
+
+func nodesEqual(a, b Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if isNumeric(a) && isNumeric(b) {
+		if a.Type() == Decimal || b.Type() == Decimal {
+			ad, aok := a.To(Decimal).(DecimalNode)
+			bd, bok := b.To(Decimal).(DecimalNode)
+			return aok && bok && ad.rat.Cmp(bd.rat) == 0
+		}
+		af, aok := a.To(Float).(FloatNode)
+		bf, bok := b.To(Float).(FloatNode)
+		return aok && bok && af == bf
+	}
+	return a.Type() == b.Type() && a.String() == b.String()
+}
+
+func isNumeric(n Node) bool {
+	switch n.Type() {
+	case Int, Float, Number, Decimal:
+		return true
+	default:
+		return false
+	}
+}
+
+func evalArith(op int, lhs, rhs Node) Node {
+	if !isNumeric(lhs) || !isNumeric(rhs) {
+		if op == OpAdd && lhs.Type() == String && rhs.Type() == String {
+			return StringNode(lhs.String() + rhs.String())
+		}
+		return UNDEFINED_RESULT
+	}
+	if lhs.Type() == Decimal || rhs.Type() == Decimal {
+		return evalDecimalArith(op, lhs, rhs)
+	}
+	if lhs.Type() == Float || rhs.Type() == Float {
+		lf := float64(lhs.To(Float).(FloatNode))
+		rf := float64(rhs.To(Float).(FloatNode))
+		switch op {
+		case OpAdd:
+			return FloatNode(lf + rf)
+		case OpSub:
+			return FloatNode(lf - rf)
+		case OpMul:
+			return FloatNode(lf * rf)
+		case OpDiv:
+			if rf == 0 {
+				return UNDEFINED_RESULT
+			}
+			return FloatNode(lf / rf)
+		case OpMod:
+			return UNDEFINED_RESULT
+		}
+	}
+	li := int64(lhs.To(Int).(IntNode))
+	ri := int64(rhs.To(Int).(IntNode))
+	switch op {
+	case OpAdd:
+		return IntNode(li + ri)
+	case OpSub:
+		return IntNode(li - ri)
+	case OpMul:
+		return IntNode(li * ri)
+	case OpDiv:
+		if ri == 0 {
+			return UNDEFINED_RESULT
+		}
+		return IntNode(li / ri)
+	case OpMod:
+		if ri == 0 {
+			return UNDEFINED_RESULT
+		}
+		return IntNode(li % ri)
+	}
+	return UNDEFINED_RESULT
+}
+
+func evalCompare(op int, lhs, rhs Node) Node {
+	if !isNumeric(lhs) || !isNumeric(rhs) {
+		l, r := lhs.String(), rhs.String()
+		switch op {
+		case OpLt:
+			return BoolNode(l < r)
+		case OpLe:
+			return BoolNode(l <= r)
+		case OpGt:
+			return BoolNode(l > r)
+		case OpGe:
+			return BoolNode(l >= r)
+		}
+	}
+	if lhs.Type() == Decimal || rhs.Type() == Decimal {
+		return evalDecimalCompare(op, lhs, rhs)
+	}
+	lf := float64(lhs.To(Float).(FloatNode))
+	rf := float64(rhs.To(Float).(FloatNode))
+	switch op {
+	case OpLt:
+		return BoolNode(lf < rf)
+	case OpLe:
+		return BoolNode(lf <= rf)
+	case OpGt:
+		return BoolNode(lf > rf)
+	case OpGe:
+		return BoolNode(lf >= rf)
+	}
+	return UNDEFINED_RESULT
+}
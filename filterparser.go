@@ -0,0 +1,310 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseFilterExpr parses a JSONPath filter-selector body, e.g.
+// `@.price < 10 && @.category == "fiction"`, into the shared Expr AST
+// (BinaryExpr/CallExpr/JSONPathExpr/literal Nodes) so it can be run
+// through EvalExpr exactly like any other tdtl expression.
+func parseFilterExpr(s string) (Expr, error) {
+	p := &filterParser{toks: tokenizeFilter(s), src: s}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("tdtl: unexpected trailing input in filter %q", s)
+	}
+	return expr, nil
+}
+
+type filterToken struct {
+	kind string // "op", "path", "num", "str", "bool", "ident", "lparen", "rparen", "comma"
+	text string
+}
+
+func tokenizeFilter(s string) []filterToken {
+	var toks []filterToken
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			toks = append(toks, filterToken{"lparen", "("})
+			i++
+		case c == ')':
+			toks = append(toks, filterToken{"rparen", ")"})
+			i++
+		case c == ',':
+			toks = append(toks, filterToken{"comma", ","})
+			i++
+		case strings.HasPrefix(s[i:], "&&"):
+			toks = append(toks, filterToken{"op", "&&"})
+			i += 2
+		case strings.HasPrefix(s[i:], "||"):
+			toks = append(toks, filterToken{"op", "||"})
+			i += 2
+		case strings.HasPrefix(s[i:], "=="):
+			toks = append(toks, filterToken{"op", "=="})
+			i += 2
+		case strings.HasPrefix(s[i:], "!="):
+			toks = append(toks, filterToken{"op", "!="})
+			i += 2
+		case strings.HasPrefix(s[i:], "<="):
+			toks = append(toks, filterToken{"op", "<="})
+			i += 2
+		case strings.HasPrefix(s[i:], ">="):
+			toks = append(toks, filterToken{"op", ">="})
+			i += 2
+		case c == '<' || c == '>':
+			toks = append(toks, filterToken{"op", string(c)})
+			i++
+		case c == '!':
+			toks = append(toks, filterToken{"op", "!"})
+			i++
+		case c == '\'' || c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				j++
+			}
+			toks = append(toks, filterToken{"str", s[i+1 : j]})
+			i = j + 1
+		case c == '@' || c == '$':
+			j := i + 1
+			for j < len(s) && (isPathByte(s[j])) {
+				j++
+			}
+			toks = append(toks, filterToken{"path", s[i:j]})
+			i = j
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, filterToken{"num", s[i:j]})
+			i = j
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(s) && isIdentByte(s[j]) {
+				j++
+			}
+			word := s[i:j]
+			if word == "true" || word == "false" {
+				toks = append(toks, filterToken{"bool", word})
+			} else {
+				toks = append(toks, filterToken{"ident", word})
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return toks
+}
+
+func isPathByte(c byte) bool {
+	return c == '.' || c == '[' || c == ']' || c == '\'' || c == '"' || c == '_' || c == '-' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentByte(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+type filterParser struct {
+	toks []filterToken
+	pos  int
+	src  string
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.pos >= len(p.toks) {
+		return filterToken{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+func (p *filterParser) next() (filterToken, bool) {
+	t, ok := p.peek()
+	if ok {
+		p.pos++
+	}
+	return t, ok
+}
+
+func (p *filterParser) parseOr() (Expr, error) {
+	lhs, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != "op" || t.text != "||" {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: OpOr, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *filterParser) parseAnd() (Expr, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != "op" || t.text != "&&" {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: OpAnd, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *filterParser) parseUnary() (Expr, error) {
+	if t, ok := p.peek(); ok && t.kind == "op" && t.text == "!" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpr{Op: OpNot, LHS: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (Expr, error) {
+	lhs, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.peek()
+	if !ok || t.kind != "op" {
+		return lhs, nil
+	}
+	op, isCompare := compareOps[t.text]
+	if !isCompare {
+		return lhs, nil
+	}
+	p.next()
+	rhs, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryExpr{Op: op, LHS: lhs, RHS: rhs}, nil
+}
+
+var compareOps = map[string]int{
+	"==": OpEq,
+	"!=": OpNe,
+	"<":  OpLt,
+	"<=": OpLe,
+	">":  OpGt,
+	">=": OpGe,
+}
+
+func (p *filterParser) parsePrimary() (Expr, error) {
+	t, ok := p.next()
+	if !ok {
+		return nil, fmt.Errorf("tdtl: unexpected end of filter expression %q", p.src)
+	}
+	switch t.kind {
+	case "lparen":
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing, ok := p.next()
+		if !ok || closing.kind != "rparen" {
+			return nil, fmt.Errorf("tdtl: expected ')' in filter expression %q", p.src)
+		}
+		return expr, nil
+	case "path":
+		return &JSONPathExpr{val: t.text}, nil
+	case "str":
+		return StringNode(t.text), nil
+	case "bool":
+		return BoolNode(t.text == "true"), nil
+	case "num":
+		// Route through the same int64/float64/Decimal promotion NewNode
+		// uses elsewhere, so a filter predicate can compare against a
+		// numeral too large or precise for int64/float64 (e.g.
+		// $.items[?(@.amount > 100000000000000000000)]) instead of
+		// hard-failing to parse.
+		n := decimalFromNumber(t.text)
+		if n == UNDEFINED_RESULT {
+			return nil, fmt.Errorf("tdtl: bad number %q in filter expression", t.text)
+		}
+		return n.(Expr), nil
+	case "ident":
+		if next, ok := p.peek(); ok && next.kind == "lparen" {
+			p.next()
+			args, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			return &CallExpr{raw: t.text, key: t.text, args: args}, nil
+		}
+		return nil, fmt.Errorf("tdtl: unexpected identifier %q in filter expression", t.text)
+	default:
+		return nil, fmt.Errorf("tdtl: unexpected token %q in filter expression %q", t.text, p.src)
+	}
+}
+
+func (p *filterParser) parseArgs() ([]Expr, error) {
+	var args []Expr
+	if t, ok := p.peek(); ok && t.kind == "rparen" {
+		p.next()
+		return args, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		t, ok := p.next()
+		if !ok {
+			return nil, fmt.Errorf("tdtl: unterminated argument list in filter expression %q", p.src)
+		}
+		if t.kind == "rparen" {
+			return args, nil
+		}
+		if t.kind != "comma" {
+			return nil, fmt.Errorf("tdtl: expected ',' or ')' in filter expression %q", p.src)
+		}
+	}
+}
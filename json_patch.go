@@ -0,0 +1,351 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// decodeJSON unmarshals data into a generic interface{} tree with
+// json.Decoder.UseNumber, so a number decodes as a json.Number that
+// NewNode can route through decimalFromNumber instead of every number
+// being downgraded to a precision-losing float64 before any tdtl logic
+// runs.
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// PatchOp is a single RFC 6902 JSON Patch operation.
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Patch applies a sequence of RFC 6902 JSON Patch operations and
+// returns the resulting document. Operations are applied in order to a
+// decoded copy, so the receiver is never modified; if any operation
+// errors, Patch returns an empty JSONNode and that error.
+func (r JSONNode) Patch(ops []PatchOp) (JSONNode, error) {
+	var doc interface{}
+	if err := decodeJSON([]byte(r), &doc); err != nil {
+		return "", fmt.Errorf("tdtl: patch: %w", err)
+	}
+	for _, op := range ops {
+		var err error
+		doc, err = applyPatchOp(doc, op)
+		if err != nil {
+			return "", err
+		}
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("tdtl: patch: %w", err)
+	}
+	return JSONNode(data), nil
+}
+
+func applyPatchOp(doc interface{}, op PatchOp) (interface{}, error) {
+	tokens, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		return jsonPointerSet(doc, tokens, op.Value, "add")
+	case "remove":
+		return jsonPointerSet(doc, tokens, nil, "remove")
+	case "replace":
+		return jsonPointerSet(doc, tokens, op.Value, "replace")
+	case "move":
+		fromTokens, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		val, err := jsonPointerGet(doc, fromTokens)
+		if err != nil {
+			return nil, err
+		}
+		doc, err = jsonPointerSet(doc, fromTokens, nil, "remove")
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerSet(doc, tokens, val, "add")
+	case "copy":
+		fromTokens, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		val, err := jsonPointerGet(doc, fromTokens)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerSet(doc, tokens, val, "add")
+	case "test":
+		val, err := jsonPointerGet(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+		// nodesEqual rather than reflect.DeepEqual, so a test against a
+		// numeral compares by value rather than by Go's decoded
+		// representation: doc numbers decode as json.Number (see
+		// decodeJSON) while op.Value may be a plain float64 supplied by
+		// the caller.
+		if !nodesEqual(NewNode(val), NewNode(op.Value)) {
+			return nil, fmt.Errorf("tdtl: patch: test failed at %q", op.Path)
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("tdtl: patch: unknown op %q", op.Op)
+	}
+}
+
+// Merge applies an RFC 7396 JSON Merge Patch: recursively merges patch
+// into the receiver, where a null member deletes the corresponding
+// target member and a non-object patch replaces the target outright.
+func (r JSONNode) Merge(patch JSONNode) (JSONNode, error) {
+	var doc interface{}
+	if err := decodeJSON([]byte(r), &doc); err != nil {
+		return "", fmt.Errorf("tdtl: merge: %w", err)
+	}
+	var p interface{}
+	if err := decodeJSON([]byte(patch), &p); err != nil {
+		return "", fmt.Errorf("tdtl: merge: %w", err)
+	}
+	data, err := json.Marshal(mergePatch(doc, p))
+	if err != nil {
+		return "", fmt.Errorf("tdtl: merge: %w", err)
+	}
+	return JSONNode(data), nil
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergePatch(targetObj[k], v)
+	}
+	return targetObj
+}
+
+// Get reads the member at key, which may be either a dotted path
+// ("a.b.0") or a JSON Pointer ("/a/b/0"), returning UNDEFINED_RESULT if
+// any segment is missing.
+func (r JSONNode) Get(key string) Node {
+	var doc interface{}
+	if err := decodeJSON([]byte(r), &doc); err != nil {
+		return UNDEFINED_RESULT
+	}
+	tokens, err := parseJSONPointer(toJSONPointer(key))
+	if err != nil {
+		return UNDEFINED_RESULT
+	}
+	val, err := jsonPointerGet(doc, tokens)
+	if err != nil {
+		return UNDEFINED_RESULT
+	}
+	return NewNode(val)
+}
+
+// Delete removes the member at key, which may be a dotted path or a
+// JSON Pointer, and returns the resulting document.
+func (r JSONNode) Delete(key string) (val string, err error) {
+	var doc interface{}
+	if err = decodeJSON([]byte(r), &doc); err != nil {
+		return "", fmt.Errorf("tdtl: delete: %w", err)
+	}
+	tokens, err := parseJSONPointer(toJSONPointer(key))
+	if err != nil {
+		return "", err
+	}
+	doc, err = jsonPointerSet(doc, tokens, nil, "remove")
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("tdtl: delete: %w", err)
+	}
+	return string(data), nil
+}
+
+// toJSONPointer turns a dotted path ("a.b.0") into a JSON Pointer
+// ("/a/b/0"); paths already in pointer form pass through unchanged.
+func toJSONPointer(key string) string {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return key
+	}
+	return "/" + strings.ReplaceAll(key, ".", "/")
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into its unescaped
+// reference tokens. The empty string denotes the whole document.
+func parseJSONPointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("tdtl: invalid JSON pointer %q", path)
+	}
+	raw := strings.Split(path[1:], "/")
+	tokens := make([]string, len(raw))
+	for i, t := range raw {
+		t = strings.ReplaceAll(t, "~1", "/")
+		t = strings.ReplaceAll(t, "~0", "~")
+		tokens[i] = t
+	}
+	return tokens, nil
+}
+
+// jsonPointerGet resolves tokens against doc, descending through maps
+// and slices.
+func jsonPointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	cur := doc
+	for _, tok := range tokens {
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			v, ok := c[tok]
+			if !ok {
+				return nil, fmt.Errorf("tdtl: member %q not found", tok)
+			}
+			cur = v
+		case []interface{}:
+			idx, _, err := jsonPointerIndex(tok, len(c))
+			if err != nil {
+				return nil, err
+			}
+			if idx >= len(c) {
+				return nil, fmt.Errorf("tdtl: index %d out of range", idx)
+			}
+			cur = c[idx]
+		default:
+			return nil, fmt.Errorf("tdtl: cannot descend into %T at %q", cur, tok)
+		}
+	}
+	return cur, nil
+}
+
+// jsonPointerSet applies an add/replace/remove of val at tokens within
+// doc, returning the (possibly new, for slice growth) document root.
+func jsonPointerSet(doc interface{}, tokens []string, val interface{}, mode string) (interface{}, error) {
+	if len(tokens) == 0 {
+		if mode == "remove" {
+			return nil, fmt.Errorf("tdtl: cannot remove the document root")
+		}
+		return val, nil
+	}
+	tok, rest := tokens[0], tokens[1:]
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			switch mode {
+			case "add":
+				container[tok] = val
+			case "replace":
+				if _, ok := container[tok]; !ok {
+					return nil, fmt.Errorf("tdtl: replace target %q does not exist", tok)
+				}
+				container[tok] = val
+			case "remove":
+				if _, ok := container[tok]; !ok {
+					return nil, fmt.Errorf("tdtl: remove target %q does not exist", tok)
+				}
+				delete(container, tok)
+			}
+			return container, nil
+		}
+		child, ok := container[tok]
+		if !ok {
+			return nil, fmt.Errorf("tdtl: member %q not found", tok)
+		}
+		newChild, err := jsonPointerSet(child, rest, val, mode)
+		if err != nil {
+			return nil, err
+		}
+		container[tok] = newChild
+		return container, nil
+	case []interface{}:
+		idx, appendAt, err := jsonPointerIndex(tok, len(container))
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			switch mode {
+			case "add":
+				if appendAt {
+					container = append(container, val)
+				} else {
+					container = append(container, nil)
+					copy(container[idx+1:], container[idx:len(container)-1])
+					container[idx] = val
+				}
+			case "replace":
+				if idx >= len(container) {
+					return nil, fmt.Errorf("tdtl: index %d out of range", idx)
+				}
+				container[idx] = val
+			case "remove":
+				if idx >= len(container) {
+					return nil, fmt.Errorf("tdtl: index %d out of range", idx)
+				}
+				container = append(container[:idx], container[idx+1:]...)
+			}
+			return container, nil
+		}
+		if idx >= len(container) {
+			return nil, fmt.Errorf("tdtl: index %d out of range", idx)
+		}
+		newChild, err := jsonPointerSet(container[idx], rest, val, mode)
+		if err != nil {
+			return nil, err
+		}
+		container[idx] = newChild
+		return container, nil
+	default:
+		return nil, fmt.Errorf("tdtl: cannot descend into %T at %q", doc, tok)
+	}
+}
+
+// jsonPointerIndex resolves an array reference token: "-" means
+// append-at-end, otherwise it must be a non-negative integer no larger
+// than the array's length.
+func jsonPointerIndex(tok string, n int) (idx int, appendAt bool, err error) {
+	if tok == "-" {
+		return n, true, nil
+	}
+	idx, err = strconv.Atoi(tok)
+	if err != nil || idx < 0 || idx > n {
+		return 0, false, fmt.Errorf("tdtl: invalid array index %q", tok)
+	}
+	return idx, idx == n, nil
+}
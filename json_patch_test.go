@@ -0,0 +1,194 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONNodePatch(t *testing.T) {
+	cases := []struct {
+		name    string
+		doc     JSONNode
+		ops     []PatchOp
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "add",
+			doc:  `{"a":1}`,
+			ops:  []PatchOp{{Op: "add", Path: "/b", Value: 2.0}},
+			want: `{"a":1,"b":2}`,
+		},
+		{
+			name: "replace",
+			doc:  `{"a":1}`,
+			ops:  []PatchOp{{Op: "replace", Path: "/a", Value: 2.0}},
+			want: `{"a":2}`,
+		},
+		{
+			name: "remove",
+			doc:  `{"a":1,"b":2}`,
+			ops:  []PatchOp{{Op: "remove", Path: "/b"}},
+			want: `{"a":1}`,
+		},
+		{
+			name: "move",
+			doc:  `{"a":1}`,
+			ops:  []PatchOp{{Op: "move", From: "/a", Path: "/b"}},
+			want: `{"b":1}`,
+		},
+		{
+			name: "copy",
+			doc:  `{"a":1}`,
+			ops:  []PatchOp{{Op: "copy", From: "/a", Path: "/b"}},
+			want: `{"a":1,"b":1}`,
+		},
+		{
+			name: "test passes, then add",
+			doc:  `{"a":1}`,
+			ops: []PatchOp{
+				{Op: "test", Path: "/a", Value: 1.0},
+				{Op: "add", Path: "/b", Value: 2.0},
+			},
+			want: `{"a":1,"b":2}`,
+		},
+		{
+			name:    "test fails",
+			doc:     `{"a":1}`,
+			ops:     []PatchOp{{Op: "test", Path: "/a", Value: 2.0}},
+			wantErr: true,
+		},
+		{
+			name:    "replace missing member",
+			doc:     `{"a":1}`,
+			ops:     []PatchOp{{Op: "replace", Path: "/missing", Value: 2.0}},
+			wantErr: true,
+		},
+		{
+			name:    "remove out of range array index",
+			doc:     `{"a":[1,2]}`,
+			ops:     []PatchOp{{Op: "remove", Path: "/a/5"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid path, not pointer form",
+			doc:     `{"a":1}`,
+			ops:     []PatchOp{{Op: "add", Path: "a", Value: 2.0}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown op",
+			doc:     `{"a":1}`,
+			ops:     []PatchOp{{Op: "frobnicate", Path: "/a"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.doc.Patch(tc.ops)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Patch(%v) = %q, want error", tc.ops, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Patch(%v): %v", tc.ops, err)
+			}
+			assertJSONEqual(t, string(got), tc.want)
+		})
+	}
+}
+
+func TestJSONNodePatchAtomicOnError(t *testing.T) {
+	doc := JSONNode(`{"a":1}`)
+	_, err := doc.Patch([]PatchOp{
+		{Op: "add", Path: "/b", Value: 2.0},
+		{Op: "replace", Path: "/missing", Value: 3.0},
+	})
+	if err == nil {
+		t.Fatal("expected an error from the second op")
+	}
+	if string(doc) != `{"a":1}` {
+		t.Fatalf("receiver mutated: %s", doc)
+	}
+}
+
+func TestJSONNodeMerge(t *testing.T) {
+	cases := []struct {
+		name  string
+		doc   JSONNode
+		patch JSONNode
+		want  string
+	}{
+		{
+			name:  "replace a member",
+			doc:   `{"a":1,"b":2}`,
+			patch: `{"a":3}`,
+			want:  `{"a":3,"b":2}`,
+		},
+		{
+			name:  "null deletes a member",
+			doc:   `{"a":1,"b":2}`,
+			patch: `{"b":null}`,
+			want:  `{"a":1}`,
+		},
+		{
+			name:  "nested object merges recursively",
+			doc:   `{"a":{"x":1,"y":2}}`,
+			patch: `{"a":{"y":3}}`,
+			want:  `{"a":{"x":1,"y":3}}`,
+		},
+		{
+			name:  "non-object patch replaces outright",
+			doc:   `{"a":[1,2,3]}`,
+			patch: `{"a":[9]}`,
+			want:  `{"a":[9]}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.doc.Merge(tc.patch)
+			if err != nil {
+				t.Fatalf("Merge(%s): %v", tc.patch, err)
+			}
+			assertJSONEqual(t, string(got), tc.want)
+		})
+	}
+}
+
+// assertJSONEqual compares got and want as decoded JSON values, so key
+// order and formatting differences in the encoder's output don't fail
+// the test.
+func assertJSONEqual(t *testing.T, got, want string) {
+	t.Helper()
+	var gv, wv interface{}
+	if err := json.Unmarshal([]byte(got), &gv); err != nil {
+		t.Fatalf("invalid JSON produced: %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wv); err != nil {
+		t.Fatalf("invalid want JSON: %s: %v", want, err)
+	}
+	gb, _ := json.Marshal(gv)
+	wb, _ := json.Marshal(wv)
+	if string(gb) != string(wb) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,462 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// segKind distinguishes the RFC 9535 selector kinds a compiled
+// JSONPathExpr segment can hold.
+type segKind int
+
+const (
+	segChild segKind = iota
+	segWildcard
+	segRecursive
+	segIndex
+	segSlice
+	segUnion
+	segFilter
+)
+
+// pathSegment is one compiled step of a JSONPathExpr, applied in order
+// against the node set produced by the previous step.
+type pathSegment struct {
+	kind segKind
+	name string // segChild
+
+	// segIndex
+	index int
+
+	// segSlice: zero value + has* flags distinguishes "omitted" from "0".
+	hasStart, hasEnd, hasStep bool
+	start, end, step          int
+
+	// segUnion: a mix of names and indices, applied in order.
+	names   []string
+	indices []int
+
+	// segFilter
+	filter Expr
+}
+
+var pathCache sync.Map // string -> *JSONPathExpr
+
+// CompileJSONPath parses path once and returns a cached *JSONPathExpr
+// for it, so evaluating the same path against many messages (as the
+// streaming window runtime does) doesn't re-parse on every event.
+func CompileJSONPath(path string) (*JSONPathExpr, error) {
+	if cached, ok := pathCache.Load(path); ok {
+		p := cached.(*JSONPathExpr)
+		return p, p.compErr
+	}
+	p := &JSONPathExpr{val: path}
+	err := p.compile()
+	pathCache.Store(path, p)
+	return p, err
+}
+
+// NewJSONPathExpr compiles path into a *JSONPathExpr without touching
+// the shared cache; CompileJSONPath is preferred for hot paths.
+func NewJSONPathExpr(path string) (*JSONPathExpr, error) {
+	p := &JSONPathExpr{val: path}
+	return p, p.compile()
+}
+
+func (e *JSONPathExpr) compile() error {
+	e.compileOnce.Do(func() {
+		e.segments, e.compErr = parseJSONPath(e.val)
+		e.compiled = true
+	})
+	return e.compErr
+}
+
+// Eval resolves the compiled path against root, returning every node
+// it selects (zero, one, or many, depending on wildcards/filters/
+// recursive descent).
+func (e *JSONPathExpr) Eval(root Node) []Node {
+	if err := e.compile(); err != nil {
+		return nil
+	}
+	cur := []Node{root}
+	for _, seg := range e.segments {
+		cur = applySegment(seg, cur, root)
+	}
+	return cur
+}
+
+// eval1 resolves the path against a single Node and returns its first
+// match, or UNDEFINED_RESULT if the path selects nothing. It is the
+// convenience form Eval's callers reach for when they expect at most
+// one value, e.g. a streaming window's group-by dimension.
+func (e *JSONPathExpr) eval1(n Node) Node {
+	results := e.Eval(n)
+	if len(results) == 0 {
+		return UNDEFINED_RESULT
+	}
+	return results[0]
+}
+
+func parseJSONPath(path string) ([]pathSegment, error) {
+	s := strings.TrimSpace(path)
+	s = strings.TrimPrefix(s, "$")
+	s = strings.TrimPrefix(s, "@")
+
+	var segs []pathSegment
+	for len(s) > 0 {
+		switch {
+		case s[0] != '.' && s[0] != '[':
+			// A bare leading name ("temperature", "a.b.c") is shorthand
+			// for ".temperature"/".a.b.c" — tdtl paths need not start
+			// with "$" or a dot.
+			name, rest, err := readDotName(s)
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, pathSegment{kind: segChild, name: name})
+			s = rest
+		case strings.HasPrefix(s, ".."):
+			s = s[2:]
+			segs = append(segs, pathSegment{kind: segRecursive})
+			if s == "" || s[0] == '[' {
+				continue
+			}
+			// `..name` is shorthand for a recursive descent followed by
+			// a child access.
+			name, rest, err := readDotName(s)
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, pathSegment{kind: segChild, name: name})
+			s = rest
+		case strings.HasPrefix(s, "."):
+			s = s[1:]
+			if strings.HasPrefix(s, "*") {
+				segs = append(segs, pathSegment{kind: segWildcard})
+				s = s[1:]
+				continue
+			}
+			name, rest, err := readDotName(s)
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, pathSegment{kind: segChild, name: name})
+			s = rest
+		case strings.HasPrefix(s, "["):
+			end := matchingBracket(s)
+			if end < 0 {
+				return nil, fmt.Errorf("tdtl: unterminated '[' in JSONPath %q", path)
+			}
+			inner := s[1:end]
+			seg, err := parseBracket(inner)
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, seg)
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("tdtl: unexpected token %q in JSONPath %q", s, path)
+		}
+	}
+	return segs, nil
+}
+
+// readDotName reads a bare (unbracketed) member name following a `.`.
+func readDotName(s string) (name, rest string, err error) {
+	i := 0
+	for i < len(s) && s[i] != '.' && s[i] != '[' {
+		i++
+	}
+	if i == 0 {
+		return "", "", fmt.Errorf("tdtl: expected member name at %q", s)
+	}
+	return s[:i], s[i:], nil
+}
+
+// matchingBracket returns the index of the ']' matching the '[' at
+// s[0], respecting nested brackets and quoted strings.
+func matchingBracket(s string) int {
+	depth := 0
+	inStr := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inStr != 0 {
+			if c == inStr {
+				inStr = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"':
+			inStr = c
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseBracket(inner string) (pathSegment, error) {
+	inner = strings.TrimSpace(inner)
+	switch {
+	case inner == "*":
+		return pathSegment{kind: segWildcard}, nil
+	case strings.HasPrefix(inner, "?"):
+		expr, err := parseFilterExpr(strings.TrimSpace(inner[1:]))
+		if err != nil {
+			return pathSegment{}, err
+		}
+		return pathSegment{kind: segFilter, filter: expr}, nil
+	case strings.Contains(inner, ":"):
+		return parseSlice(inner)
+	case strings.Contains(inner, ","):
+		return parseUnion(inner)
+	default:
+		if idx, err := strconv.Atoi(inner); err == nil {
+			return pathSegment{kind: segIndex, index: idx}, nil
+		}
+		return pathSegment{kind: segChild, name: unquote(inner)}, nil
+	}
+}
+
+func parseSlice(inner string) (pathSegment, error) {
+	parts := strings.SplitN(inner, ":", 3)
+	seg := pathSegment{kind: segSlice, step: 1}
+	if v := strings.TrimSpace(parts[0]); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return seg, fmt.Errorf("tdtl: bad slice start %q", v)
+		}
+		seg.start, seg.hasStart = n, true
+	}
+	if len(parts) > 1 {
+		if v := strings.TrimSpace(parts[1]); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return seg, fmt.Errorf("tdtl: bad slice end %q", v)
+			}
+			seg.end, seg.hasEnd = n, true
+		}
+	}
+	if len(parts) > 2 {
+		if v := strings.TrimSpace(parts[2]); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return seg, fmt.Errorf("tdtl: bad slice step %q", v)
+			}
+			if n == 0 {
+				return seg, fmt.Errorf("tdtl: slice step cannot be 0")
+			}
+			seg.step, seg.hasStep = n, true
+		}
+	}
+	return seg, nil
+}
+
+func parseUnion(inner string) (pathSegment, error) {
+	var seg pathSegment
+	seg.kind = segUnion
+	for _, part := range strings.Split(inner, ",") {
+		part = strings.TrimSpace(part)
+		if idx, err := strconv.Atoi(part); err == nil {
+			seg.indices = append(seg.indices, idx)
+			seg.names = append(seg.names, "")
+			continue
+		}
+		seg.names = append(seg.names, unquote(part))
+		seg.indices = append(seg.indices, -1)
+	}
+	return seg, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 {
+		if (s[0] == '\'' && s[len(s)-1] == '\'') || (s[0] == '"' && s[len(s)-1] == '"') {
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
+
+// applySegment maps one compiled segment over a node set, producing the
+// next node set in the evaluation pipeline.
+func applySegment(seg pathSegment, cur []Node, root Node) []Node {
+	var out []Node
+	switch seg.kind {
+	case segChild:
+		for _, n := range cur {
+			if v := objectMember(n, seg.name); v != nil {
+				out = append(out, v)
+			}
+		}
+	case segWildcard:
+		for _, n := range cur {
+			out = append(out, elements(n)...)
+		}
+	case segRecursive:
+		for _, n := range cur {
+			out = append(out, n)
+			out = append(out, descendants(n)...)
+		}
+	case segIndex:
+		for _, n := range cur {
+			if v := arrayElement(n, seg.index); v != nil {
+				out = append(out, v)
+			}
+		}
+	case segSlice:
+		for _, n := range cur {
+			out = append(out, sliceElements(n, seg)...)
+		}
+	case segUnion:
+		for _, n := range cur {
+			for i, name := range seg.names {
+				if name != "" {
+					if v := objectMember(n, name); v != nil {
+						out = append(out, v)
+					}
+					continue
+				}
+				if v := arrayElement(n, seg.indices[i]); v != nil {
+					out = append(out, v)
+				}
+			}
+		}
+	case segFilter:
+		for _, n := range cur {
+			for _, el := range elements(n) {
+				env := &Env{Current: el, Root: root}
+				if b, ok := EvalExpr(seg.filter, env).(BoolNode); ok && bool(b) {
+					out = append(out, el)
+				}
+			}
+		}
+	}
+	return out
+}
+
+func objectMember(n Node, name string) Node {
+	m, ok := n.Value().(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	v, ok := m[name]
+	if !ok {
+		return nil
+	}
+	return NewNode(v)
+}
+
+func elements(n Node) []Node {
+	switch v := n.Value().(type) {
+	case map[string]interface{}:
+		out := make([]Node, 0, len(v))
+		for _, val := range v {
+			out = append(out, NewNode(val))
+		}
+		return out
+	case []interface{}:
+		out := make([]Node, 0, len(v))
+		for _, val := range v {
+			out = append(out, NewNode(val))
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func descendants(n Node) []Node {
+	var out []Node
+	for _, child := range elements(n) {
+		out = append(out, child)
+		out = append(out, descendants(child)...)
+	}
+	return out
+}
+
+func arrayElement(n Node, idx int) Node {
+	arr, ok := n.Value().([]interface{})
+	if !ok {
+		return nil
+	}
+	if idx < 0 {
+		idx += len(arr)
+	}
+	if idx < 0 || idx >= len(arr) {
+		return nil
+	}
+	return NewNode(arr[idx])
+}
+
+func sliceElements(n Node, seg pathSegment) []Node {
+	arr, ok := n.Value().([]interface{})
+	if !ok {
+		return nil
+	}
+	length := len(arr)
+	step := seg.step
+	if step == 0 {
+		step = 1
+	}
+	start, end := 0, length
+	if step < 0 {
+		start, end = length-1, -1
+	}
+	if seg.hasStart {
+		start = normalizeSliceIndex(seg.start, length)
+	}
+	if seg.hasEnd {
+		end = normalizeSliceIndex(seg.end, length)
+	}
+	var out []Node
+	if step > 0 {
+		for i := start; i < end && i < length; i += step {
+			if i >= 0 {
+				out = append(out, NewNode(arr[i]))
+			}
+		}
+	} else {
+		for i := start; i > end && i >= 0; i += step {
+			if i < length {
+				out = append(out, NewNode(arr[i]))
+			}
+		}
+	}
+	return out
+}
+
+func normalizeSliceIndex(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+	return i
+}
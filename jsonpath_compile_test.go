@@ -0,0 +1,47 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestJSONPathExprConcurrentCompile drives 20 goroutines through Eval on
+// a single never-yet-compiled *JSONPathExpr, the pattern filterparser.go's
+// literals and aggregate.go's AST paths rely on; compile must run its
+// parseJSONPath exactly once under sync.Once rather than racing.
+func TestJSONPathExprConcurrentCompile(t *testing.T) {
+	p := &JSONPathExpr{val: "$.a.b"}
+	doc := JSONNode(`{"a":{"b":42}}`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results := p.Eval(doc)
+			if len(results) != 1 {
+				t.Errorf("Eval() = %v, want a single result", results)
+				return
+			}
+			if f, ok := results[0].To(Float).(FloatNode); !ok || float64(f) != 42 {
+				t.Errorf("Eval() = %v, want [42]", results)
+			}
+		}()
+	}
+	wg.Wait()
+}
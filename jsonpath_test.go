@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import (
+	"sort"
+	"testing"
+)
+
+// evalNumbers evaluates path against doc and returns the matched leaf
+// values as float64s (JSON numbers decode as FloatNode), sorted so
+// selector order doesn't matter to the assertion.
+func evalNumbers(t *testing.T, path, doc string) []float64 {
+	t.Helper()
+	p, err := NewJSONPathExpr(path)
+	if err != nil {
+		t.Fatalf("NewJSONPathExpr(%q): %v", path, err)
+	}
+	results := p.Eval(JSONNode(doc))
+	out := make([]float64, len(results))
+	for i, r := range results {
+		f, ok := r.To(Float).(FloatNode)
+		if !ok {
+			t.Fatalf("Eval(%q) produced non-numeric result %v", path, r)
+		}
+		out[i] = float64(f)
+	}
+	sort.Float64s(out)
+	return out
+}
+
+func TestJSONPathSelectors(t *testing.T) {
+	cases := []struct {
+		name string
+		path string
+		doc  string
+		want []float64
+	}{
+		{
+			name: "dotted child",
+			path: "$.a.b",
+			doc:  `{"a":{"b":1}}`,
+			want: []float64{1},
+		},
+		{
+			name: "wildcard over object",
+			path: "$.a.*",
+			doc:  `{"a":{"x":1,"y":2}}`,
+			want: []float64{1, 2},
+		},
+		{
+			name: "slice",
+			path: "$.a[1:4]",
+			doc:  `{"a":[0,1,2,3,4]}`,
+			want: []float64{1, 2, 3},
+		},
+		{
+			name: "slice with step",
+			path: "$.a[0:5:2]",
+			doc:  `{"a":[0,1,2,3,4]}`,
+			want: []float64{0, 2, 4},
+		},
+		{
+			name: "union of indices",
+			path: "$.a[0,2]",
+			doc:  `{"a":[10,20,30]}`,
+			want: []float64{10, 30},
+		},
+		{
+			name: "union of names",
+			path: "$['a','c']",
+			doc:  `{"a":1,"b":2,"c":3}`,
+			want: []float64{1, 3},
+		},
+		{
+			name: "recursive descent",
+			path: "$..x",
+			doc:  `{"a":{"x":1},"b":{"c":{"x":2}}}`,
+			want: []float64{1, 2},
+		},
+		{
+			name: "filter selector",
+			path: "$.items[?(@.price < 10)].price",
+			doc:  `{"items":[{"price":5},{"price":15},{"price":9}]}`,
+			want: []float64{5, 9},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := evalNumbers(t, tc.path, tc.doc)
+			if len(got) != len(tc.want) {
+				t.Fatalf("Eval(%q) = %v, want %v", tc.path, got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("Eval(%q) = %v, want %v", tc.path, got, tc.want)
+					break
+				}
+			}
+		})
+	}
+}
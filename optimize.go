@@ -0,0 +1,353 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import "fmt"
+
+// PureFuncs is the builtin-function registry the optimizer may call at
+// compile time to fold a CallExpr whose arguments are all literal. It
+// is the same table JSONPath filters evaluate against at runtime (see
+// Builtins in eval.go): a builtin must already be safe to call ahead of
+// time, so there's exactly one registry rather than two that could
+// drift apart.
+var PureFuncs = Builtins
+
+// Diagnostic is a parse-time problem Optimize found while folding a
+// subtree, e.g. dividing a String by an Int. It is not fatal: the
+// offending subtree is left unfolded so the caller can still use the
+// rest of the optimized tree, but a host validating a script at deploy
+// time should treat any Diagnostic as a rejection.
+type Diagnostic struct {
+	Expr    Expr
+	Message string
+}
+
+func (d Diagnostic) Error() string { return d.Message }
+
+// Optimize walks e bottom-up, replacing any BinaryExpr/CallExpr/
+// SwitchExpr/CaseExpr subtree whose operands are all literal with the
+// Node it evaluates to, and returns the rewritten tree alongside any
+// diagnostics raised along the way.
+func Optimize(e Expr) (Expr, []Diagnostic) {
+	var diags []Diagnostic
+	return fold(e, &diags), diags
+}
+
+// Fold reduces e to a single literal Node, the degenerate case of
+// Optimize where the whole tree collapses. ok is false if e contains
+// any subtree Optimize could not resolve (a JSONPathExpr reference, an
+// impure/unknown CallExpr, or a diagnostic-raising operation).
+func Fold(e Expr) (Node, bool) {
+	folded, diags := Optimize(e)
+	if len(diags) > 0 {
+		return nil, false
+	}
+	return literalNode(folded)
+}
+
+func fold(e Expr, diags *[]Diagnostic) Expr {
+	switch v := e.(type) {
+	case *BinaryExpr:
+		return foldBinary(v, diags)
+	case *CallExpr:
+		return foldCall(v, diags)
+	case *SwitchExpr:
+		return foldSwitch(v, diags)
+	case CaseListExpr:
+		out := make(CaseListExpr, len(v))
+		for i, c := range v {
+			out[i] = fold(c, diags).(*CaseExpr)
+		}
+		return out
+	case *CaseExpr:
+		return &CaseExpr{when: fold(v.when, diags), then: fold(v.then, diags)}
+	default:
+		return e
+	}
+}
+
+func foldBinary(b *BinaryExpr, diags *[]Diagnostic) Expr {
+	lhs := fold(b.LHS, diags)
+	lhsNode, lhsLit := literalNode(lhs)
+
+	if b.Op == OpNot {
+		result := &BinaryExpr{Op: b.Op, LHS: lhs}
+		if !lhsLit {
+			return result
+		}
+		folded, err := foldNot(lhsNode)
+		if err != nil {
+			*diags = append(*diags, Diagnostic{Expr: result, Message: err.Error()})
+			return result
+		}
+		return folded
+	}
+
+	rhs := fold(b.RHS, diags)
+	result := &BinaryExpr{Op: b.Op, LHS: lhs, RHS: rhs}
+	rhsNode, rhsLit := literalNode(rhs)
+	if !lhsLit || !rhsLit {
+		return result
+	}
+	folded, err := foldBinaryOp(b.Op, lhsNode, rhsNode)
+	if err != nil {
+		*diags = append(*diags, Diagnostic{Expr: result, Message: err.Error()})
+		return result
+	}
+	return folded
+}
+
+func foldNot(lhs Node) (Expr, error) {
+	b, ok := lhs.To(Bool).(BoolNode)
+	if !ok {
+		return nil, fmt.Errorf("tdtl: cannot negate a %s", lhs.Type())
+	}
+	return BoolNode(!b), nil
+}
+
+func foldBinaryOp(op int, lhs, rhs Node) (Expr, error) {
+	switch op {
+	case OpAnd, OpOr:
+		lb, lok := lhs.To(Bool).(BoolNode)
+		rb, rok := rhs.To(Bool).(BoolNode)
+		if !lok || !rok {
+			return nil, fmt.Errorf("tdtl: logical operator needs Bool operands, got %s and %s", lhs.Type(), rhs.Type())
+		}
+		if op == OpAnd {
+			return BoolNode(bool(lb) && bool(rb)), nil
+		}
+		return BoolNode(bool(lb) || bool(rb)), nil
+	case OpEq:
+		return BoolNode(nodesEqual(lhs, rhs)), nil
+	case OpNe:
+		return BoolNode(!nodesEqual(lhs, rhs)), nil
+	case OpAdd:
+		if lhs.Type() == String && rhs.Type() == String {
+			return StringNode(lhs.String() + rhs.String()), nil
+		}
+		return foldArith(op, lhs, rhs)
+	case OpSub, OpMul, OpDiv, OpMod:
+		return foldArith(op, lhs, rhs)
+	case OpLt, OpLe, OpGt, OpGe:
+		if !isNumeric(lhs) || !isNumeric(rhs) {
+			return nil, fmt.Errorf("tdtl: cannot compare %s and %s", lhs.Type(), rhs.Type())
+		}
+		return evalCompare(op, lhs, rhs).(Expr), nil
+	default:
+		return nil, fmt.Errorf("tdtl: unknown operator %d", op)
+	}
+}
+
+func foldArith(op int, lhs, rhs Node) (Expr, error) {
+	if !isNumeric(lhs) || !isNumeric(rhs) {
+		return nil, fmt.Errorf("tdtl: arithmetic operator needs numeric operands, got %s and %s", lhs.Type(), rhs.Type())
+	}
+	result := evalArith(op, lhs, rhs)
+	if result == UNDEFINED_RESULT {
+		return nil, fmt.Errorf("tdtl: arithmetic on %s and %s is undefined (e.g. division by zero)", lhs.Type(), rhs.Type())
+	}
+	return result.(Expr), nil
+}
+
+func foldCall(c *CallExpr, diags *[]Diagnostic) Expr {
+	args := make([]Expr, len(c.args))
+	nodes := make([]Node, len(c.args))
+	allLiteral := true
+	for i, a := range c.args {
+		args[i] = fold(a, diags)
+		n, ok := literalNode(args[i])
+		if !ok {
+			allLiteral = false
+			continue
+		}
+		nodes[i] = n
+	}
+	result := &CallExpr{raw: c.raw, key: c.key, args: args}
+	if !allLiteral {
+		return result
+	}
+	fn, ok := PureFuncs[c.key]
+	if !ok {
+		// Not a known pure builtin (or a host-defined side-effecting
+		// function): leave it for the runtime to evaluate.
+		return result
+	}
+	val := fn(nodes)
+	if val == UNDEFINED_RESULT {
+		*diags = append(*diags, Diagnostic{Expr: result, Message: fmt.Sprintf("tdtl: %s() is undefined for the given arguments", c.key)})
+		return result
+	}
+	return val.(Expr)
+}
+
+// foldSwitch folds each branch's `when`, and short-circuits branches
+// that provably will or won't be taken: a branch whose when folds to
+// constant false is dropped, and the first branch whose when folds to
+// constant true ends the branch list (later branches, reachable or not,
+// no longer matter). If no unresolved branch precedes it, the whole
+// SwitchExpr collapses to that branch's then; otherwise its then becomes
+// the default after the unresolved branches.
+func foldSwitch(s *SwitchExpr, diags *[]Diagnostic) Expr {
+	var exp Expr
+	if s.exp != nil {
+		exp = fold(s.exp, diags)
+	}
+	expNode, expIsLiteral := literalNode(exp)
+
+	kept := make([]*CaseExpr, 0, len(s.list))
+	for _, c := range s.list {
+		when := fold(c.when, diags)
+		then := fold(c.then, diags)
+
+		if whenNode, ok := literalNode(when); ok {
+			taken, known := caseTaken(exp, expNode, expIsLiteral, whenNode)
+			if known {
+				if taken {
+					if len(kept) == 0 {
+						return then
+					}
+					return &SwitchExpr{exp: exp, list: kept, last: then}
+				}
+				continue
+			}
+		}
+		kept = append(kept, &CaseExpr{when: when, then: then})
+	}
+
+	var last Expr
+	if s.last != nil {
+		last = fold(s.last, diags)
+	}
+	if len(kept) == 0 {
+		if last != nil {
+			return last
+		}
+		return UNDEFINED_RESULT
+	}
+	return &SwitchExpr{exp: exp, list: kept, last: last}
+}
+
+// caseTaken decides whether a CaseExpr branch is statically known to
+// run: a `switch <exp> { when <literal> }` form compares when against
+// exp, while a condition form (no exp) treats when as the Bool guard.
+func caseTaken(exp Expr, expNode Node, expIsLiteral bool, whenNode Node) (taken, known bool) {
+	if exp != nil {
+		if !expIsLiteral {
+			return false, false
+		}
+		return nodesEqual(expNode, whenNode), true
+	}
+	b, ok := whenNode.(BoolNode)
+	if !ok {
+		return false, false
+	}
+	return bool(b), true
+}
+
+func literalNode(e Expr) (Node, bool) {
+	n, ok := e.(Node)
+	if !ok {
+		return nil, false
+	}
+	switch n.(type) {
+	case IntNode, FloatNode, StringNode, BoolNode, NullNode, DefaultNode, JSONNode, DecimalNode:
+		return n, true
+	default:
+		return nil, false
+	}
+}
+
+// Schema maps a JSONPathExpr's path string to its declared Type, so
+// TypeOf can resolve field references without a live document.
+type Schema map[string]Type
+
+// TypeOf statically infers e's Type, consulting schema for JSONPathExpr
+// leaves. It returns Undefined wherever the type can't be determined
+// ahead of time (an unknown path or function), which callers should
+// treat as "needs runtime checking", not as an error. A SwitchExpr is
+// always Undefined: its branches are not inspected, even when they all
+// have the same type.
+func TypeOf(e Expr, schema Schema) Type {
+	switch v := e.(type) {
+	case IntNode:
+		return Int
+	case FloatNode:
+		return Float
+	case StringNode:
+		return String
+	case BoolNode:
+		return Bool
+	case NullNode:
+		return Null
+	case JSONNode:
+		return JSON
+	case DecimalNode:
+		return Decimal
+	case *JSONPathExpr:
+		if t, ok := schema[v.val]; ok {
+			return t
+		}
+		return Undefined
+	case *CallExpr:
+		switch v.key {
+		case "len":
+			return Int
+		case "upper", "lower", "substring":
+			return String
+		default:
+			return Undefined
+		}
+	case *BinaryExpr:
+		return typeOfBinary(v, schema)
+	default:
+		return Undefined
+	}
+}
+
+// isArithNumeric reports whether t is one of the types evalDecimalArith
+// accepts as an operand once the other side is a Decimal.
+func isArithNumeric(t Type) bool {
+	return t == Decimal || t == Int || t == Float
+}
+
+func typeOfBinary(b *BinaryExpr, schema Schema) Type {
+	switch b.Op {
+	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe, OpAnd, OpOr, OpNot:
+		return Bool
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod:
+		lt := TypeOf(b.LHS, schema)
+		if b.RHS == nil {
+			return Undefined
+		}
+		rt := TypeOf(b.RHS, schema)
+		switch {
+		case b.Op == OpAdd && lt == String && rt == String:
+			return String
+		case (lt == Decimal || rt == Decimal) && isArithNumeric(lt) && isArithNumeric(rt):
+			return Decimal
+		case lt == Float && (rt == Float || rt == Int):
+			return Float
+		case rt == Float && (lt == Float || lt == Int):
+			return Float
+		case lt == Int && rt == Int:
+			return Int
+		default:
+			return Undefined
+		}
+	default:
+		return Undefined
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import "testing"
+
+func TestFoldArith(t *testing.T) {
+	expr := &BinaryExpr{Op: OpAdd, LHS: IntNode(2), RHS: IntNode(3)}
+	node, ok := Fold(expr)
+	if !ok {
+		t.Fatal("Fold() = !ok, want a folded literal")
+	}
+	if got, ok := node.(IntNode); !ok || got != 5 {
+		t.Errorf("Fold() = %v, want IntNode(5)", node)
+	}
+}
+
+func TestFoldLeavesUnresolvableSubtreeAndDiagnoses(t *testing.T) {
+	// Dividing a String by an Int can't be folded; Optimize should
+	// leave the BinaryExpr in place and report a Diagnostic instead of
+	// panicking or silently dropping the error.
+	expr := &BinaryExpr{Op: OpDiv, LHS: StringNode("x"), RHS: IntNode(2)}
+	folded, diags := Optimize(expr)
+	if len(diags) == 0 {
+		t.Fatal("Optimize() produced no diagnostics for an unfoldable op")
+	}
+	if _, ok := folded.(*BinaryExpr); !ok {
+		t.Errorf("Optimize() = %T, want the original BinaryExpr left unfolded", folded)
+	}
+}
+
+func TestFoldAndOr(t *testing.T) {
+	and := &BinaryExpr{Op: OpAnd, LHS: BoolNode(false), RHS: BoolNode(true)}
+	node, ok := Fold(and)
+	if !ok {
+		t.Fatal("Fold(false && true) = !ok, want BoolNode(false)")
+	}
+	if got, ok := node.(BoolNode); !ok || bool(got) {
+		t.Errorf("Fold(false && true) = %v, want false", node)
+	}
+
+	or := &BinaryExpr{Op: OpOr, LHS: BoolNode(false), RHS: BoolNode(true)}
+	node, ok = Fold(or)
+	if !ok {
+		t.Fatal("Fold(false || true) = !ok, want BoolNode(true)")
+	}
+	if got, ok := node.(BoolNode); !ok || !bool(got) {
+		t.Errorf("Fold(false || true) = %v, want true", node)
+	}
+
+	// A reference the optimizer has no document to resolve leaves the
+	// BinaryExpr in place rather than folding, even though the other
+	// operand is literal.
+	mixed := &BinaryExpr{Op: OpAnd, LHS: BoolNode(false), RHS: &JSONPathExpr{val: "$.a"}}
+	_, ok = Fold(mixed)
+	if ok {
+		t.Error("Fold(false && <path>) = ok, want unresolved (no schema-free short-circuit)")
+	}
+}
+
+func TestTypeOfBinary(t *testing.T) {
+	cases := []struct {
+		name string
+		expr Expr
+		want Type
+	}{
+		{
+			name: "int + int is int",
+			expr: &BinaryExpr{Op: OpAdd, LHS: IntNode(1), RHS: IntNode(2)},
+			want: Int,
+		},
+		{
+			name: "int + float is float",
+			expr: &BinaryExpr{Op: OpAdd, LHS: IntNode(1), RHS: FloatNode(2)},
+			want: Float,
+		},
+		{
+			name: "string + string is string",
+			expr: &BinaryExpr{Op: OpAdd, LHS: StringNode("a"), RHS: StringNode("b")},
+			want: String,
+		},
+		{
+			name: "comparison is bool",
+			expr: &BinaryExpr{Op: OpLt, LHS: IntNode(1), RHS: IntNode(2)},
+			want: Bool,
+		},
+		{
+			name: "field reference resolves via schema",
+			expr: &JSONPathExpr{val: "$.temperature"},
+			want: Float,
+		},
+		{
+			name: "unknown field reference is undefined",
+			expr: &JSONPathExpr{val: "$.unknown"},
+			want: Undefined,
+		},
+	}
+
+	schema := Schema{"$.temperature": Float}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := TypeOf(tc.expr, schema); got != tc.want {
+				t.Errorf("TypeOf() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Clock abstracts wall-clock access so tests can drive window closing
+// deterministically instead of racing a real timer.
+type Clock interface {
+	Now() int64
+}
+
+// SystemClock is the default Clock, returning unix millis.
+type SystemClock struct{}
+
+// Now returns the current time in unix milliseconds.
+func (SystemClock) Now() int64 { return time.Now().UnixMilli() }
+
+// Result is a single emitted window pane: the evaluated fields for one
+// dimension key over [Start, End).
+type Result struct {
+	Dimension string
+	Start     int64
+	End       int64
+	Fields    map[string]Node
+}
+
+// StreamOption configures a Stream at construction time.
+type StreamOption func(*Stream)
+
+// WithClock overrides the Clock used to drive watermark advancement.
+func WithClock(c Clock) StreamOption {
+	return func(s *Stream) { s.clock = c }
+}
+
+// WithAllowedLateness sets how far (in millis) behind the watermark an
+// event may arrive and still be accepted into an already-open pane.
+func WithAllowedLateness(ms int64) StreamOption {
+	return func(s *Stream) { s.allowedLateness = ms }
+}
+
+// WithResultBuffer sets the buffer size of the Results channel.
+func WithResultBuffer(n int) StreamOption {
+	return func(s *Stream) { s.resultBuf = n }
+}
+
+// paneEvent is one event buffered in a pane, along with the event-time
+// timestamp it was pushed with. Sliding windows need the timestamp to
+// evict events that have aged out of [ts-length, ts] on every push;
+// fixed-grid and session windows ignore it and just fold p.nodes().
+type paneEvent struct {
+	ts int64
+	n  Node
+}
+
+// pane accumulates the raw events for one window instance of one
+// dimension key, waiting to be folded into a Result on close.
+type pane struct {
+	start  int64
+	end    int64
+	events []paneEvent
+}
+
+// nodes returns the buffered events as a plain []Node, the shape the
+// aggFuncs in aggregate.go operate on.
+func (p *pane) nodes() []Node {
+	out := make([]Node, len(p.events))
+	for i, ev := range p.events {
+		out[i] = ev.n
+	}
+	return out
+}
+
+// Stream evaluates a SelectStatementExpr's WindowExpr/DimensionsExpr
+// against a live sequence of Node events, emitting one Result per closed
+// window pane per dimension key.
+type Stream struct {
+	stmt            *SelectStatementExpr
+	clock           Clock
+	allowedLateness int64
+	resultBuf       int
+
+	mu        sync.Mutex
+	watermark int64
+	panes     map[string]map[int64]*pane // dimension key -> pane start -> pane
+	sessions  map[string]*pane           // dimension key -> open session pane
+
+	out    chan *Result
+	closed bool
+}
+
+// NewStream builds a Stream that evaluates stmt's window against events
+// pushed via Push. stmt.dimensions must carry a non-nil window, or
+// NewStream panics, mirroring the repo's convention of failing fast on
+// malformed ASTs rather than returning a sentinel error from a
+// constructor.
+func NewStream(stmt *SelectStatementExpr, opts ...StreamOption) *Stream {
+	if stmt == nil || stmt.dimensions == nil || stmt.dimensions.window == nil {
+		panic("tdtl: NewStream requires a SelectStatementExpr with a windowed DimensionsExpr")
+	}
+	s := &Stream{
+		stmt:      stmt,
+		clock:     SystemClock{},
+		resultBuf: 16,
+		panes:     make(map[string]map[int64]*pane),
+		sessions:  make(map[string]*pane),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.out = make(chan *Result, s.resultBuf)
+	return s
+}
+
+// Results returns the channel Result panes are emitted on. It is closed
+// once Close has flushed all outstanding panes.
+func (s *Stream) Results() <-chan *Result {
+	return s.out
+}
+
+// Push ingests one event timestamped ts. Events older than the current
+// watermark minus the allowed lateness are dropped as too-late.
+func (s *Stream) Push(ts int64, n Node) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("tdtl: stream is closed")
+	}
+	if ts < s.watermark-s.allowedLateness {
+		return fmt.Errorf("tdtl: event at %d dropped, older than watermark-lateness %d", ts, s.watermark-s.allowedLateness)
+	}
+	if ts > s.watermark {
+		s.watermark = ts
+	}
+
+	key := s.dimensionKey(n)
+	win := s.stmt.dimensions.window
+	switch win.WindowType {
+	case TUMBLING_WINDOW:
+		s.pushFixed(key, ts, n, int64(win.Length), int64(win.Length))
+	case HOPPING_WINDOW:
+		s.pushFixed(key, ts, n, int64(win.Length), int64(win.Interval))
+	case SLIDING_WINDOW:
+		s.pushSliding(key, ts, n, int64(win.Length))
+	case SESSION_WINDOW:
+		s.pushSession(key, ts, n, int64(win.Interval))
+	default:
+		return fmt.Errorf("tdtl: unsupported window type %v", win.WindowType)
+	}
+	s.closeExpiredLocked()
+	return nil
+}
+
+// pushFixed handles both tumbling (length == interval) and hopping
+// (length > interval, producing overlapping panes) windows. An event at
+// ts belongs to every pane whose [start, start+length) contains ts,
+// where start is a non-negative multiple of interval.
+func (s *Stream) pushFixed(key string, ts int64, n Node, length, interval int64) {
+	if interval <= 0 {
+		interval = length
+	}
+	first := ((ts - length) / interval) * interval
+	for start := first; start <= ts; start += interval {
+		if start < 0 {
+			continue
+		}
+		if ts < start || ts >= start+length {
+			continue
+		}
+		p := s.paneFor(key, start, start+length)
+		p.events = append(p.events, paneEvent{ts: ts, n: n})
+	}
+}
+
+// pushSliding recomputes a [ts-length, ts] pane on every event and emits
+// it immediately; sliding windows have no fixed grid to wait on.
+func (s *Stream) pushSliding(key string, ts int64, n Node, length int64) {
+	bucket, ok := s.panes[key]
+	if !ok {
+		bucket = make(map[int64]*pane)
+		s.panes[key] = bucket
+	}
+	p, ok := bucket[0]
+	if !ok {
+		p = &pane{start: ts - length, end: ts}
+		bucket[0] = p
+	}
+	p.events = append(p.events, paneEvent{ts: ts, n: n})
+	cutoff := ts - length
+	kept := p.events[:0]
+	for _, ev := range p.events {
+		if ev.ts >= cutoff {
+			kept = append(kept, ev)
+		}
+	}
+	p.events = kept
+	p.start, p.end = cutoff, ts
+	s.emit(key, p)
+}
+
+// pushSession extends the open session pane for key, or closes it and
+// starts a fresh one if the gap since the last event exceeds interval.
+func (s *Stream) pushSession(key string, ts int64, n Node, interval int64) {
+	p, ok := s.sessions[key]
+	if ok && ts-p.end > interval {
+		s.emit(key, p)
+		delete(s.sessions, key)
+		ok = false
+	}
+	if !ok {
+		p = &pane{start: ts, end: ts}
+		s.sessions[key] = p
+	}
+	p.events = append(p.events, paneEvent{ts: ts, n: n})
+	if ts > p.end {
+		p.end = ts
+	}
+}
+
+func (s *Stream) paneFor(key string, start, end int64) *pane {
+	bucket, ok := s.panes[key]
+	if !ok {
+		bucket = make(map[int64]*pane)
+		s.panes[key] = bucket
+	}
+	p, ok := bucket[start]
+	if !ok {
+		p = &pane{start: start, end: end}
+		bucket[start] = p
+	}
+	return p
+}
+
+// closeExpiredLocked emits and discards any fixed-grid pane whose end
+// has fallen behind the watermark minus the allowed lateness, and any
+// session whose gap has exceeded the session interval as of now.
+func (s *Stream) closeExpiredLocked() {
+	win := s.stmt.dimensions.window
+	deadline := s.watermark - s.allowedLateness
+	for key, bucket := range s.panes {
+		for start, p := range bucket {
+			if win.WindowType == SLIDING_WINDOW {
+				continue
+			}
+			if p.end <= deadline {
+				s.emit(key, p)
+				delete(bucket, start)
+			}
+		}
+	}
+	if win.WindowType == SESSION_WINDOW {
+		for key, p := range s.sessions {
+			if s.watermark-p.end > int64(win.Interval) {
+				s.emit(key, p)
+				delete(s.sessions, key)
+			}
+		}
+	}
+}
+
+// emit evaluates the SelectStatementExpr's fields over a pane's buffered
+// events and publishes the Result, dropping it if the channel is full
+// rather than blocking the ingest path.
+func (s *Stream) emit(key string, p *pane) {
+	events := p.nodes()
+	fields := make(map[string]Node, len(s.stmt.fields))
+	for _, f := range s.stmt.fields {
+		name, val := evalAggField(f, events)
+		fields[name] = val
+	}
+	r := &Result{Dimension: key, Start: p.start, End: p.end, Fields: fields}
+	select {
+	case s.out <- r:
+	default:
+	}
+}
+
+// Close flushes every open pane as a final Result and closes the
+// Results channel. It is safe to call Close more than once.
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	for key, bucket := range s.panes {
+		for _, p := range bucket {
+			s.emit(key, p)
+		}
+	}
+	for key, p := range s.sessions {
+		s.emit(key, p)
+	}
+	s.closed = true
+	close(s.out)
+	return nil
+}
+
+// Tick closes any pane that has gone idle according to the Stream's
+// Clock rather than event time, e.g. a session or hopping window with
+// no traffic to advance the watermark. Production callers driven by
+// SystemClock should invoke Tick from their own periodic timer; tests
+// advance a fake Clock and call Tick directly for deterministic
+// window-close assertions.
+func (s *Stream) Tick() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	now := s.clock.Now()
+	if now > s.watermark {
+		s.watermark = now
+	}
+	s.closeExpiredLocked()
+}
+
+// dimensionKey renders the group-by key for n by evaluating each
+// DimensionsExpr path against it and joining the results with "|".
+func (s *Stream) dimensionKey(n Node) string {
+	dims := s.stmt.dimensions
+	if len(dims.exprs) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(dims.exprs))
+	for _, p := range dims.exprs {
+		parts = append(parts, p.eval1(n).String())
+	}
+	return strings.Join(parts, "|")
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The tKeel Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tdtl
+
+import "testing"
+
+// fakeClock lets tests advance watermark-driven idle closing (Tick)
+// deterministically instead of racing a real timer.
+type fakeClock struct{ t int64 }
+
+func (c *fakeClock) Now() int64 { return c.t }
+
+func TestStreamSlidingWindowEvictsAgedOutEvents(t *testing.T) {
+	stmt := &SelectStatementExpr{
+		fields: FieldsExpr{
+			&FieldExpr{exp: &CallExpr{key: "count"}, alias: "cnt"},
+			&FieldExpr{exp: &CallExpr{key: "sum", args: []Expr{&JSONPathExpr{val: "value"}}}, alias: "total"},
+		},
+		dimensions: &DimensionsExpr{
+			window: &WindowExpr{WindowType: SLIDING_WINDOW, Length: WindowLength(10)},
+		},
+	}
+	s := NewStream(stmt, WithResultBuffer(16))
+	defer s.Close()
+
+	var last *Result
+	for i := 0; i <= 10; i++ {
+		ts := int64(i * 10)
+		n := NewNode(map[string]interface{}{"value": float64(i)})
+		if err := s.Push(ts, n); err != nil {
+			t.Fatalf("Push(%d): %v", ts, err)
+		}
+		select {
+		case last = <-s.Results():
+		default:
+			t.Fatalf("expected a Result after push at ts=%d", ts)
+		}
+	}
+
+	// Only the events within [100-10, 100] = {ts=90, ts=100} should
+	// still be in the pane; a stale pane would carry all 11 pushes.
+	if got, ok := last.Fields["cnt"].(IntNode); !ok || got != 2 {
+		t.Errorf("cnt = %v, want 2", last.Fields["cnt"])
+	}
+	if got, ok := last.Fields["total"].(FloatNode); !ok || got != 19 {
+		t.Errorf("total = %v, want 19", last.Fields["total"])
+	}
+}
+
+func TestStreamTumblingWindowClosesOnIdleTick(t *testing.T) {
+	stmt := &SelectStatementExpr{
+		fields: FieldsExpr{
+			&FieldExpr{exp: &CallExpr{key: "count"}, alias: "cnt"},
+		},
+		dimensions: &DimensionsExpr{
+			window: &WindowExpr{WindowType: TUMBLING_WINDOW, Length: WindowLength(10)},
+		},
+	}
+	clock := &fakeClock{}
+	s := NewStream(stmt, WithClock(clock), WithResultBuffer(4))
+	defer s.Close()
+
+	if err := s.Push(1, NewNode(map[string]interface{}{"value": 1.0})); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	select {
+	case r := <-s.Results():
+		t.Fatalf("pane closed before its window elapsed: %+v", r)
+	default:
+	}
+
+	clock.t = 25
+	s.Tick()
+
+	select {
+	case r := <-s.Results():
+		if got, ok := r.Fields["cnt"].(IntNode); !ok || got != 1 {
+			t.Errorf("cnt = %v, want 1", r.Fields["cnt"])
+		}
+	default:
+		t.Fatal("expected the tumbling pane to close after an idle Tick")
+	}
+}
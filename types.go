@@ -18,9 +18,11 @@ package tdtl
 import (
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 var (
@@ -51,6 +53,8 @@ const (
 	Array
 	// JSON is a raw block of JSON
 	JSON
+	// Decimal is an exact-precision number, backed by a big.Rat
+	Decimal
 )
 
 // String returns a string representation of the type.
@@ -70,6 +74,8 @@ func (t Type) String() string {
 		return "String"
 	case JSON:
 		return "JSON"
+	case Decimal:
+		return "Decimal"
 	}
 }
 
@@ -125,6 +131,8 @@ func (r IntNode) To(typ Type) Node {
 		return r
 	case Float:
 		return FloatNode(r)
+	case Decimal:
+		return NewDecimalNode(new(big.Rat).SetInt64(int64(r)))
 	case String:
 		return StringNode(fmt.Sprintf("%d", r))
 	}
@@ -144,6 +152,12 @@ func (r FloatNode) To(typ Type) Node {
 		return r
 	case Int:
 		return IntNode(r)
+	case Decimal:
+		rat := new(big.Rat).SetFloat64(float64(r))
+		if rat == nil {
+			return UNDEFINED_RESULT
+		}
+		return NewDecimalNode(rat)
 	case String:
 		return StringNode(fmt.Sprintf("%f", r))
 	}
@@ -184,6 +198,12 @@ func (r StringNode) To(typ Type) Node {
 			return UNDEFINED_RESULT
 		}
 		return FloatNode(b)
+	case Decimal:
+		rat, ok := new(big.Rat).SetString(string(r))
+		if !ok {
+			return UNDEFINED_RESULT
+		}
+		return NewDecimalNode(rat)
 	}
 	return UNDEFINED_RESULT
 }
@@ -245,25 +265,45 @@ func (r JSONNode) Value() interface{} {
 	return data
 }
 func (r JSONNode) Update(key string, value Node) (val string, err error) {
-	switch value := value.(type) {
-	case FloatNode, IntNode, BoolNode:
-		v := value.To(String)
-		switch v := v.(type) {
-		case StringNode:
-			val, err = updateJSON(r, key, v)
-		}
+	if jv, ok := value.(JSONNode); ok && key == "" {
+		return string(jv), nil
+	}
+
+	tokens, err := parseJSONPointer(toJSONPointer(key))
+	if err != nil {
+		return "", err
+	}
+
+	var doc interface{}
+	if err = decodeJSON([]byte(r), &doc); err != nil {
+		return "", fmt.Errorf("tdtl: update: %w", err)
+	}
+
+	var raw interface{}
+	switch v := value.(type) {
+	case BoolNode:
+		raw = bool(v)
+	case IntNode, FloatNode, DecimalNode:
+		raw = json.Number(v.String())
 	case StringNode:
-		val, err = updateJSON(r, key, "\""+value+"\"")
+		raw = string(v)
 	case JSONNode:
-		if key == "" {
-			val = string(value)
-		} else {
-			val, err = updateJSON(r, key, StringNode(value))
+		if err = decodeJSON([]byte(v), &raw); err != nil {
+			return "", fmt.Errorf("tdtl: update: %w", err)
 		}
 	default:
-		val, err = "", fmt.Errorf("unknown type")
+		return "", fmt.Errorf("unknown type")
+	}
+
+	doc, err = jsonPointerSet(doc, tokens, raw, "add")
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("tdtl: update: %w", err)
 	}
-	return
+	return string(data), nil
 }
 func (r JSONNode) String() string {
 	return string(r)
@@ -290,6 +330,7 @@ func (BoolNode) expr()    {}
 func (IntNode) expr()     {}
 func (FloatNode) expr()   {}
 func (StringNode) expr()  {}
+func (NullNode) expr()    {}
 func (*CallExpr) expr()   {}
 func (JSONNode) expr()    {}
 
@@ -302,7 +343,17 @@ type BinaryExpr struct {
 
 //JSONPathExpr xpath
 type JSONPathExpr struct {
-	val string
+	val      string
+	segments []pathSegment
+	compiled bool
+	compErr  error
+
+	// compileOnce guards segments/compErr/compiled so a *JSONPathExpr
+	// built without CompileJSONPath (filterparser.go's literals, or an
+	// AST path that aggregate.go and stream.go evaluate) and shared
+	// across goroutines before its first Eval compiles at most once
+	// instead of racing.
+	compileOnce sync.Once
 }
 
 //CallExpr
@@ -433,7 +484,16 @@ func NewNode(v interface{}) Node {
 		return FloatNode(val)
 	case uint8, int8, uint16, int16, uint, int, uint32, int32, int64, uint64:
 		return StringNode(fmt.Sprintf("%v", val)).To(Int)
+	case json.Number:
+		return decimalFromNumber(string(val))
+	case *big.Int:
+		return nodeFromBigInt(val)
+	case *big.Rat:
+		return nodeFromBigRat(val)
 	case string:
+		if d, ok := decimalFromString(val); ok {
+			return d
+		}
 		return StringNode(val)
 	case []byte:
 		return JSONNode(val)